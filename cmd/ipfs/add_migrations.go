@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+	"github.com/ipfs/go-ipfs/repo/fsrepo/migrations/ipfsfetcher"
+
+	files "github.com/ipfs/go-ipfs-files"
+	iface "github.com/ipfs/interface-go-ipfs-core"
+	icorepath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// addMigrations imports the migration artifacts that fetcher retrieved for
+// this run into node, so operators who fetched over the network contribute
+// that bandwidth back instead of only ever consuming it. As documented on
+// Migration.Keep in config.go, only Keep=pin does this: an unpinned import
+// gains nothing, since the next GC would drop it straight back out, so
+// both addMigrationsFromIpfsFetcher and addMigrationsFromDownloadDirectory
+// skip the import entirely unless pin is true.
+//
+// addMigrations must be called after the migrations that used fetcher have
+// completed; reading from a fetcher that is still downloading would race
+// with its own fetches.
+func addMigrations(ctx context.Context, node *core.IpfsNode, fetcher migrations.Fetcher, pin bool) error {
+	api, err := coreapi.NewCoreAPI(node)
+	if err != nil {
+		return fmt.Errorf("cannot get core API to add migrations: %w", err)
+	}
+
+	if f, ok := fetcher.(*ipfsfetcher.IpfsFetcher); ok {
+		return addMigrationsFromIpfsFetcher(ctx, api, f, pin)
+	}
+	return addMigrationsFromDownloadDirectory(ctx, api, pin)
+}
+
+// addMigrationsFromIpfsFetcher connects to f's temporary migration node and
+// pins the CIDs it served over bitswap, so that node keeps serving them
+// after the temporary node shuts down. If pin is false there is nothing
+// useful to do here: the content already lives in f's temporary node, and
+// pulling it into node without pinning would just have it collected by the
+// next GC, so the function returns immediately without connecting.
+func addMigrationsFromIpfsFetcher(ctx context.Context, api iface.CoreAPI, f *ipfsfetcher.IpfsFetcher, pin bool) error {
+	if !pin {
+		return nil
+	}
+
+	addr, ok := f.NodeAddr()
+	if !ok {
+		// The fetcher never started its temporary node (Fetch was never
+		// called, or the node failed to start); nothing to re-seed from it.
+		return nil
+	}
+
+	if err := api.Swarm().Connect(ctx, addr); err != nil {
+		return fmt.Errorf("cannot connect to migration fetch node: %w", err)
+	}
+
+	for _, c := range f.FetchedCids() {
+		p := icorepath.IpfsPath(c)
+		if err := api.Pin().Add(ctx, p); err != nil {
+			return fmt.Errorf("cannot pin fetched migration %s: %w", c, err)
+		}
+	}
+
+	return nil
+}
+
+// addMigrationsFromDownloadDirectory imports every file found in
+// migrations.DownloadDirectory and pins it, for fetchers (HttpFetcher,
+// MultiFetcher made up of HttpFetchers) that wrote archives straight to
+// disk rather than serving a UnixFS DAG we could fetch from. Per
+// Migration.Keep's documented semantics, it is a no-op unless pin is true:
+// Keep values other than "pin" only govern whether the downloaded file
+// itself is kept on disk, not whether it's imported into node.
+func addMigrationsFromDownloadDirectory(ctx context.Context, api iface.CoreAPI, pin bool) error {
+	if !pin {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(migrations.DownloadDirectory)
+	if err != nil {
+		return fmt.Errorf("cannot read migrations download directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		fullPath := filepath.Join(migrations.DownloadDirectory, entry.Name())
+		if err := addMigrationFile(ctx, api, fullPath); err != nil {
+			return fmt.Errorf("cannot add migration file %s: %w", fullPath, err)
+		}
+	}
+
+	return nil
+}
+
+// addMigrationFile imports and pins a single migration artifact. It is
+// only called once addMigrationsFromDownloadDirectory has already
+// confirmed pin is true, so it always pins.
+func addMigrationFile(ctx context.Context, api iface.CoreAPI, filePath string) error {
+	f, err := files.NewSerialFile(filePath, false, nil)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	added, err := api.Unixfs().Add(ctx, f)
+	if err != nil {
+		return err
+	}
+	return api.Pin().Add(ctx, added)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	config "github.com/ipfs/go-ipfs-config"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	"github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+
+	iface "github.com/ipfs/interface-go-ipfs-core"
+)
+
+// newTestNode starts a throwaway, offline IPFS node backed by a temp repo,
+// for tests that only need a local blockstore/pinner and no networking.
+func newTestNode(t *testing.T) iface.CoreAPI {
+	t.Helper()
+
+	repoRoot, err := os.MkdirTemp("", "add-migrations-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(repoRoot) })
+
+	cfg, err := config.Init(io.Discard, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fsrepo.Init(repoRoot, cfg); err != nil {
+		t.Fatal(err)
+	}
+	r, err := fsrepo.Open(repoRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{Online: false, Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { node.Close() })
+
+	api, err := coreapi.NewCoreAPI(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api
+}
+
+func withDownloadDirectory(t *testing.T, dir string) {
+	t.Helper()
+	orig := migrations.DownloadDirectory
+	migrations.DownloadDirectory = dir
+	t.Cleanup(func() { migrations.DownloadDirectory = orig })
+}
+
+// TestAddMigrationsFromDownloadDirectorySkipsWithoutPin confirms that, per
+// Migration.Keep's documented semantics, nothing is imported when pin is
+// false - not even an attempt to read the download directory, which is why
+// this test can point it at a path that does not exist.
+func TestAddMigrationsFromDownloadDirectorySkipsWithoutPin(t *testing.T) {
+	withDownloadDirectory(t, filepath.Join(t.TempDir(), "does-not-exist"))
+
+	if err := addMigrationsFromDownloadDirectory(context.Background(), nil, false); err != nil {
+		t.Fatalf("expected no-op when pin is false, got: %v", err)
+	}
+}
+
+// TestAddMigrationsFromDownloadDirectoryImportsAndPinsWhenRequested confirms
+// that, with pin true, every file in the download directory is imported
+// into the node and pinned.
+func TestAddMigrationsFromDownloadDirectoryImportsAndPinsWhenRequested(t *testing.T) {
+	api := newTestNode(t)
+
+	dir := t.TempDir()
+	withDownloadDirectory(t, dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "fs-repo-9-to-10"), []byte("fake migration binary"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := addMigrationsFromDownloadDirectory(ctx, api, true); err != nil {
+		t.Fatal(err)
+	}
+
+	pins, err := api.Pin().Ls(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for range pins {
+		count++
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 pin after importing 1 migration file, got %d", count)
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -9,62 +8,46 @@ import (
 	config "github.com/ipfs/go-ipfs-config"
 	"github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
 	"github.com/ipfs/go-ipfs/repo/fsrepo/migrations/ipfsfetcher"
+	peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
+// These tests only cover that the cmd/ipfs wrappers delegate to the
+// migrations package correctly; the full behavior of each function is
+// exercised by the migrations package's own tests.
+
 var configData = `
 {
 	"Bootstrap": [
-		"/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt",
-		"/ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ"
+		"/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt"
 	],
 	"Migration": {
-		"DownloadSources": ["IPFS", "HTTP", "127.0.0.1"],
+		"DownloadSources": ["IPFS", "HTTP"],
 		"Keep": "cache"
 	},
 	"Peering": {
 		"Peers": [
 			{
 				"ID": "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5",
-				"Addrs": ["/ip4/127.0.0.1/tcp/4001", "/ip4/127.0.0.1/udp/4001/quic"]
+				"Addrs": ["/ip4/127.0.0.1/tcp/4001"]
 			}
 		]
 	}
 }
 `
 
-var configDataBadPeers = `
-{
-	"Bootstrap": [
-		"/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt",
-		"/ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ"
-	],
-	"Migration": {
-		"DownloadSources": ["IPFS", "HTTP", "127.0.0.1"],
-		"Keep": "cache"
-	},
-	"Peering": "Unreadable-data"
-}
-`
+func makeConfig(configData string) string {
+	tmpDir, err := os.MkdirTemp("", "migration_test")
+	if err != nil {
+		panic(err)
+	}
 
-var configDataBadBootstrap = `
-{
-	"Bootstrap": "unreadable",
-	"Migration": {
-		"DownloadSources": ["IPFS", "HTTP", "127.0.0.1"],
-		"Keep": "cache"
-	},
-	"Peering": {
-		"Peers": [
-			{
-				"ID": "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5",
-				"Addrs": ["/ip4/127.0.0.1/tcp/4001", "/ip4/127.0.0.1/udp/4001/quic"]
-			}
-		]
+	if err := os.WriteFile(filepath.Join(tmpDir, "config"), []byte(configData), 0644); err != nil {
+		panic(err)
 	}
+	return tmpDir
 }
-`
 
-func TestReadMigrationConfig(t *testing.T) {
+func TestReadMigrationConfigDelegates(t *testing.T) {
 	tmpDir := makeConfig(configData)
 	defer os.RemoveAll(tmpDir)
 
@@ -72,167 +55,85 @@ func TestReadMigrationConfig(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	if len(cfg.DownloadSources) != 3 {
-		t.Fatal("wrong number of DownloadSources")
-	}
-	expect := []string{"IPFS", "HTTP", "127.0.0.1"}
-	for i := range expect {
-		if cfg.DownloadSources[i] != expect[i] {
-			t.Errorf("wrong DownloadSource at %d", i)
-		}
-	}
-
 	if cfg.Keep != "cache" {
 		t.Error("wrong value for Keep")
 	}
 }
 
-func TestReadIpfsConfig(t *testing.T) {
+func TestReadIpfsConfigDelegates(t *testing.T) {
 	tmpDir := makeConfig(configData)
 	defer os.RemoveAll(tmpDir)
 
-	bootstrap, peers := readIpfsConfig(nil)
-	if bootstrap != nil || peers != nil {
-		t.Fatal("expected nil ipfs config items")
-	}
-
-	bootstrap, peers = readIpfsConfig(&tmpDir)
-	if len(bootstrap) != 2 {
-		t.Fatal("wrong number of bootstrap addresses")
-	}
-	if bootstrap[0] != "/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt" {
-		t.Fatal("wrong bootstrap address")
-	}
-
-	if len(peers) != 1 {
-		t.Fatal("wrong number of peers")
-	}
-
-	peer := peers[0]
-	if peer.ID.String() != "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5" {
-		t.Errorf("wrong ID for first peer")
-	}
-	if len(peer.Addrs) != 2 {
-		t.Error("wrong number of addrs for first peer")
-	}
-}
-
-func TestReadPartialIpfsConfig(t *testing.T) {
-	tmpDir := makeConfig(configDataBadBootstrap)
-	defer os.RemoveAll(tmpDir)
-
 	bootstrap, peers := readIpfsConfig(&tmpDir)
-	if bootstrap != nil {
-		t.Fatal("expected nil bootstrap")
+	if len(bootstrap) != 1 {
+		t.Fatal("wrong number of bootstrap addresses")
 	}
 	if len(peers) != 1 {
 		t.Fatal("wrong number of peers")
 	}
-	if len(peers[0].Addrs) != 2 {
-		t.Error("wrong number of addrs for first peer")
-	}
-	os.RemoveAll(tmpDir)
-
-	tmpDir = makeConfig(configDataBadPeers)
-	defer os.RemoveAll(tmpDir)
-
-	bootstrap, peers = readIpfsConfig(&tmpDir)
-	if peers != nil {
-		t.Fatal("expected nil peers")
-	}
-	if len(bootstrap) != 2 {
-		t.Fatal("wrong number of bootstrap addresses")
-	}
-	if bootstrap[0] != "/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt" {
-		t.Fatal("wrong bootstrap address")
-	}
 }
 
-func makeConfig(configData string) string {
-	tmpDir, err := ioutil.TempDir("", "migration_test")
-	if err != nil {
-		panic(err)
-	}
+func TestGetMigrationFetcherDelegates(t *testing.T) {
+	cfg := &config.Migration{DownloadSources: []string{"ipfs"}}
 
-	cfgFile, err := os.Create(filepath.Join(tmpDir, "config"))
+	somePeer := peer.AddrInfo{ID: "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5"}
+	f, err := getMigrationFetcher(cfg, []string{"/ip4/1.2.3.4/tcp/4001/p2p/QmFoo"}, []peer.AddrInfo{somePeer})
 	if err != nil {
-		panic(err)
-	}
-	if _, err = cfgFile.Write([]byte(configData)); err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
-	if err = cfgFile.Close(); err != nil {
-		panic(err)
+	if _, ok := f.(*ipfsfetcher.IpfsFetcher); !ok {
+		t.Fatal("expected IpfsFetcher")
 	}
-	return tmpDir
-}
-
-func TestGetMigrationFetcher(t *testing.T) {
-	var f migrations.Fetcher
-	var err error
-
-	cfg := &config.Migration{}
 
 	cfg.DownloadSources = []string{"ftp://bad.gateway.io"}
-	_, err = getMigrationFetcher(cfg, nil)
-	if err == nil {
-		t.Fatal("Expected bad URL scheme error")
+	if _, err := getMigrationFetcher(cfg, nil, nil); err == nil {
+		t.Fatal("expected bad URL scheme error")
 	}
+}
 
-	cfg.DownloadSources = []string{"ipfs"}
-	f, err = getMigrationFetcher(cfg, nil)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if _, ok := f.(*ipfsfetcher.IpfsFetcher); !ok {
-		t.Fatal("expected IpfsFetcher")
-	}
+func TestGetMigrationFetcherDelegatesHttp(t *testing.T) {
+	cfg := &config.Migration{DownloadSources: []string{"http"}}
 
-	cfg.DownloadSources = []string{"http"}
-	f, err = getMigrationFetcher(cfg, nil)
+	f, err := getMigrationFetcher(cfg, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if _, ok := f.(*migrations.HttpFetcher); !ok {
 		t.Fatal("expected HttpFetcher")
 	}
+}
 
-	cfg.DownloadSources = []string{"IPFS", "HTTPS"}
-	f, err = getMigrationFetcher(cfg, nil)
-	if err != nil {
-		t.Fatal(err)
-	}
-	mf, ok := f.(*migrations.MultiFetcher)
-	if !ok {
-		t.Fatal("expected MultiFetcher")
+func TestResolveMigrateKeep(t *testing.T) {
+	keep, err := resolveMigrateKeep("cache", "")
+	if err != nil || keep != "cache" {
+		t.Fatalf("expected config value to pass through unchanged, got %q, %v", keep, err)
 	}
-	if mf.Len() != 2 {
-		t.Fatal("expected 2 fetchers in MultiFetcher")
+
+	keep, err = resolveMigrateKeep("cache", "pin")
+	if err != nil || keep != "pin" {
+		t.Fatalf("expected flag to override config, got %q, %v", keep, err)
 	}
 
-	cfg.DownloadSources = []string{"ipfs", "https", "some.domain.io"}
-	f, err = getMigrationFetcher(cfg, nil)
-	if err != nil {
-		t.Fatal(err)
+	if _, err = resolveMigrateKeep("cache", "bogus"); err == nil {
+		t.Fatal("expected error for unrecognized --migrate-keep value")
 	}
-	mf, ok = f.(*migrations.MultiFetcher)
-	if !ok {
-		t.Fatal("expected MultiFetcher")
+}
+
+func TestResolveMigratePin(t *testing.T) {
+	if resolveMigratePin("cache", nil) {
+		t.Fatal("expected no pin by default for Keep=cache")
 	}
-	if mf.Len() != 3 {
-		t.Fatal("expected 3 fetchers in MultiFetcher")
+	if !resolveMigratePin("pin", nil) {
+		t.Fatal("expected pin when Keep=pin")
 	}
 
-	cfg.DownloadSources = nil
-	_, err = getMigrationFetcher(cfg, nil)
-	if err == nil {
-		t.Fatal("expected error when no sources specified")
+	flagTrue := true
+	if !resolveMigratePin("cache", &flagTrue) {
+		t.Fatal("expected --migrate-pin=true to override Keep=cache")
 	}
 
-	cfg.DownloadSources = []string{"", ""}
-	_, err = getMigrationFetcher(cfg, nil)
-	if err == nil {
-		t.Fatal("expected error when empty string fetchers specified")
+	flagFalse := false
+	if resolveMigratePin("pin", &flagFalse) {
+		t.Fatal("expected --migrate-pin=false to override Keep=pin")
 	}
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	config "github.com/ipfs/go-ipfs-config"
+	"github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+	"github.com/ipfs/go-ipfs/repo/fsrepo/migrations/ipfsfetcher"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// The functions in this file are thin compatibility shims around the
+// exported migrations package API, kept so existing callers within
+// cmd/ipfs do not need to change. New code, and anything outside Kubo that
+// wants to drive migrations, should call the migrations package directly.
+//
+// resolveMigrateKeep and resolveMigratePin exist for the daemon command to
+// call once it registers --migrate-keep/--migrate-pin and runs migrations
+// on startup; this checkout's cmd/ipfs does not include daemon.go, so that
+// registration and the addMigrations call described in its doc comment are
+// not wired up here yet.
+
+// readMigrationConfig reads the Migration section out of the repo's config
+// file at repoRoot. See migrations.ReadMigrationConfig.
+func readMigrationConfig(repoRoot string) (*config.Migration, error) {
+	return migrations.ReadMigrationConfig(repoRoot)
+}
+
+// readIpfsConfig reads the Bootstrap and Peering.Peers lists out of the
+// repo's config file at *repoRoot. See migrations.ReadIpfsConfig.
+func readIpfsConfig(repoRoot *string) ([]string, []peer.AddrInfo) {
+	return migrations.ReadIpfsConfig(repoRoot)
+}
+
+// getMigrationFetcher creates a fetcher, or set of fetchers, according to
+// the sources listed in cfg.DownloadSources, using bootstrap to seed the
+// temporary IPFS node for any "IPFS" source and pre-connecting it to peers
+// (typically the repo's Peering.Peers). See migrations.GetMigrationFetcher.
+func getMigrationFetcher(cfg *config.Migration, bootstrap []string, peers []peer.AddrInfo) (migrations.Fetcher, error) {
+	return migrations.GetMigrationFetcher(cfg, userAgent(), peers, func(peers []peer.AddrInfo) migrations.Fetcher {
+		return ipfsfetcher.NewIpfsFetcher(migrations.DistPath, 0, bootstrap, peers)
+	})
+}
+
+// userAgent returns the string sent as the User-Agent header by migration
+// fetchers.
+func userAgent() string {
+	return "go-ipfs"
+}
+
+// resolveMigrateKeep applies the daemon command's --migrate-keep flag, if
+// set, as an override of the repo config's Migration.Keep, so that a
+// single run can override the persisted config without editing it. An
+// empty flagKeep leaves cfgKeep unchanged; any other value must be a
+// recognized Keep value.
+func resolveMigrateKeep(cfgKeep string, flagKeep string) (string, error) {
+	if flagKeep == "" {
+		return cfgKeep, nil
+	}
+	if err := migrations.ValidateKeepValue(flagKeep); err != nil {
+		return "", err
+	}
+	return flagKeep, nil
+}
+
+// resolveMigratePin applies the daemon command's --migrate-pin flag, if
+// set, as an override of whichever Keep value was resolved above; it lets
+// --migrate-pin=true force pinning even when Keep is "cache" or "keep".
+func resolveMigratePin(keep string, flagPin *bool) bool {
+	if flagPin != nil {
+		return *flagPin
+	}
+	return keep == "pin"
+}
@@ -0,0 +1,218 @@
+package migrations
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	pb "github.com/ipfs/go-merkledag/pb"
+	unixfspb "github.com/ipfs/go-unixfs/pb"
+)
+
+// defaultMaxBlockSize is the largest single CAR frame (CID + block data)
+// that verifyingCarExtractor will accept. It guards against a malicious or
+// misbehaving gateway sending an oversized frame to exhaust memory before
+// the block's hash can even be checked.
+const defaultMaxBlockSize = 4 << 20 // 4MiB, matches the UnixFS chunker's practical ceiling
+
+// verifyingCarExtractor reads a CARv1 byte stream containing a UnixFS DAG,
+// verifies every block against its own CID before trusting its contents,
+// and writes the reassembled file data to an io.Writer as it is resolved.
+//
+// Blocks are allowed to arrive from the remote in any order: a block that
+// arrives before the traversal reaches it is verified immediately and held
+// in a pending set, keyed by CID, until the walk needs it. Blocks that turn
+// out to be unreferenced by the DAG are never removed from that set and are
+// dropped only once extraction completes. The pending set has no size limit
+// of its own: its growth is bounded only by how much of the stream the
+// caller lets the extractor read.
+type verifyingCarExtractor struct {
+	maxBlockSize int64
+	pending      map[string][]byte
+}
+
+func newVerifyingCarExtractor(maxBlockSize int64) *verifyingCarExtractor {
+	if maxBlockSize <= 0 {
+		maxBlockSize = defaultMaxBlockSize
+	}
+	return &verifyingCarExtractor{
+		maxBlockSize: maxBlockSize,
+		pending:      make(map[string][]byte),
+	}
+}
+
+// extract streams r, a CARv1 encoded response for root, verifying and
+// depth-first walking the UnixFS DAG rooted at root, writing the file's
+// bytes to out in order.
+func (x *verifyingCarExtractor) extract(ctx context.Context, r io.Reader, root cid.Cid, out io.Writer) error {
+	br := bufio.NewReader(r)
+
+	if err := skipCarHeader(br, x.maxBlockSize); err != nil {
+		return fmt.Errorf("reading CAR header: %w", err)
+	}
+
+	rootData, err := x.readUntil(br, root)
+	if err != nil {
+		return err
+	}
+	if err := x.walk(ctx, br, root, rootData, out); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// readUntil consumes frames from br, verifying each against its own CID,
+// until it produces the block for want. Blocks for other CIDs are stashed
+// in x.pending so that later, out-of-order requests for them are served
+// without re-reading the stream.
+func (x *verifyingCarExtractor) readUntil(br *bufio.Reader, want cid.Cid) ([]byte, error) {
+	if data, ok := x.pending[want.KeyString()]; ok {
+		delete(x.pending, want.KeyString())
+		return data, nil
+	}
+
+	for {
+		c, data, err := readCarFrame(br, x.maxBlockSize)
+		if err == io.EOF {
+			return nil, fmt.Errorf("truncated CAR stream: missing block %s", want)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyBlock(c, data); err != nil {
+			return nil, err
+		}
+		if c.Equals(want) {
+			return data, nil
+		}
+		x.pending[c.KeyString()] = data
+	}
+}
+
+// walk depth-first traverses the UnixFS node at c/data, requesting each
+// child link in turn and writing leaf file data to out.
+func (x *verifyingCarExtractor) walk(ctx context.Context, br *bufio.Reader, c cid.Cid, data []byte, out io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	fileData, links, err := decodeUnixfsNode(c, data)
+	if err != nil {
+		return err
+	}
+	if len(fileData) > 0 {
+		if _, err := out.Write(fileData); err != nil {
+			return err
+		}
+	}
+	for _, link := range links {
+		childData, err := x.readUntil(br, link)
+		if err != nil {
+			return err
+		}
+		if err := x.walk(ctx, br, link, childData, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readCarFrame reads a single length-prefixed (CID, block-data) frame from
+// br, enforcing maxSize before allocating a buffer for it.
+func readCarFrame(br *bufio.Reader, maxSize int64) (cid.Cid, []byte, error) {
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return cid.Undef, nil, err
+	}
+	if length == 0 {
+		return cid.Undef, nil, fmt.Errorf("invalid zero-length CAR frame")
+	}
+	if int64(length) > maxSize {
+		return cid.Undef, nil, fmt.Errorf("CAR frame of %d bytes exceeds %d byte limit", length, maxSize)
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return cid.Undef, nil, err
+	}
+
+	c, n, err := cid.CidFromBytes(buf)
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("decoding frame CID: %w", err)
+	}
+	return c, buf[n:], nil
+}
+
+// skipCarHeader discards the varint-prefixed CARv1 header frame (the
+// dag-cbor encoded root list and version); we already know the root we
+// asked for and verify every block independently, so the header's
+// contents are not load-bearing here.
+func skipCarHeader(br *bufio.Reader, maxSize int64) error {
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+	if int64(length) > maxSize {
+		return fmt.Errorf("CAR header of %d bytes exceeds %d byte limit", length, maxSize)
+	}
+	_, err = br.Discard(int(length))
+	return err
+}
+
+// verifyBlock recomputes the multihash of data using c's own hash function
+// and length, and rejects the block if it does not match c's hash. This is
+// the core trust boundary: every byte written to disk has been hashed
+// locally, regardless of what the remote server claims.
+func verifyBlock(c cid.Cid, data []byte) error {
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return fmt.Errorf("hashing block %s: %w", c, err)
+	}
+	if !sum.Equals(c) {
+		return fmt.Errorf("block failed hash verification: got %s, want %s", sum, c)
+	}
+	return nil
+}
+
+// decodeUnixfsNode decodes the UnixFS node at c/data, returning any raw
+// file data it carries directly and the CIDs of any child links, in the
+// order they should be visited. c's CID codec determines how data is
+// interpreted: a raw-codec block (the default leaf representation since
+// RawLeaves became the default in go-ipfs 0.5) is literal file bytes with
+// no links; anything else is a dag-pb node wrapping a UnixFS payload.
+func decodeUnixfsNode(c cid.Cid, data []byte) ([]byte, []cid.Cid, error) {
+	if c.Prefix().Codec == cid.Raw {
+		return data, nil, nil
+	}
+
+	var node pb.PBNode
+	if err := node.Unmarshal(data); err != nil {
+		return nil, nil, fmt.Errorf("decoding merkledag node %s: %w", c, err)
+	}
+
+	var fsNode unixfspb.Data
+	if err := fsNode.Unmarshal(node.Data); err != nil {
+		return nil, nil, fmt.Errorf("decoding unixfs data for %s: %w", c, err)
+	}
+
+	links := make([]cid.Cid, 0, len(node.Links))
+	for _, l := range node.Links {
+		linkCid, err := cid.Cast(l.Hash)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decoding link CID in %s: %w", c, err)
+		}
+		links = append(links, linkCid)
+	}
+
+	return fsNode.GetData(), links, nil
+}
@@ -0,0 +1,180 @@
+package migrations
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	config "github.com/ipfs/go-ipfs-config"
+	"github.com/ipfs/go-ipfs/repo/fsrepo/migrations/ipfsfetcher"
+
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+var log = logging.Logger("migrations")
+
+// DistPath is the path, within the distribution, that migration binaries
+// are published under.
+const DistPath = "fs-repo-migrations"
+
+// defaultGatewayURL is used when a DownloadSources entry is the bare
+// keyword "HTTP" or "HTTPS", rather than an explicit URL.
+const defaultGatewayURL = "https://dist.ipfs.tech"
+
+// ReadMigrationConfig reads the Migration section out of the repo's config
+// file at repoRoot, without otherwise parsing or validating the rest of the
+// config.
+func ReadMigrationConfig(repoRoot string) (*config.Migration, error) {
+	cfgPath := filepath.Join(repoRoot, "config")
+
+	f, err := os.Open(cfgPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cfg struct {
+		Migration config.Migration
+	}
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("cannot decode config file at %s: %w", cfgPath, err)
+	}
+
+	if err := ValidateKeepValue(cfg.Migration.Keep); err != nil {
+		return nil, err
+	}
+
+	return &cfg.Migration, nil
+}
+
+// validKeepValues are the recognized values for Migration.Keep:
+//   - "cache" (default): keep the downloaded migration until it is reused,
+//     then discard it
+//   - "keep": keep the downloaded migration around indefinitely
+//   - "pin": keep the downloaded migration and import+pin it into the local
+//     node, so its bandwidth is contributed back to the network
+//   - "discard": delete the downloaded migration as soon as it has run
+var validKeepValues = map[string]bool{
+	"":        true,
+	"cache":   true,
+	"keep":    true,
+	"pin":     true,
+	"discard": true,
+}
+
+// ValidateKeepValue reports whether keep is a recognized value for
+// Migration.Keep, returning an error describing the problem if not.
+func ValidateKeepValue(keep string) error {
+	if !validKeepValues[strings.ToLower(keep)] {
+		return fmt.Errorf("unrecognized value %q for Migration.Keep", keep)
+	}
+	return nil
+}
+
+// ReadIpfsConfig reads the Bootstrap and Peering.Peers lists out of the
+// repo's config file at *repoRoot, for use in seeding the temporary IPFS
+// node used by the IpfsFetcher. Each list is decoded independently, so a
+// malformed value in one does not prevent the other from being read.
+// ReadIpfsConfig returns (nil, nil) if repoRoot is nil.
+func ReadIpfsConfig(repoRoot *string) ([]string, []peer.AddrInfo) {
+	if repoRoot == nil {
+		return nil, nil
+	}
+
+	cfgPath := filepath.Join(*repoRoot, "config")
+	cfgFile, err := os.Open(cfgPath)
+	if err != nil {
+		log.Error("could not open config file to read bootstrap peers:", err)
+		return nil, nil
+	}
+	defer cfgFile.Close()
+
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(cfgFile).Decode(&raw); err != nil {
+		log.Error("could not decode config file:", err)
+		return nil, nil
+	}
+
+	var bootstrap []string
+	if data, ok := raw["Bootstrap"]; ok {
+		if err := json.Unmarshal(data, &bootstrap); err != nil {
+			log.Error("failed to parse bootstrap addresses from config:", err)
+			bootstrap = nil
+		}
+	}
+
+	var peers []peer.AddrInfo
+	if data, ok := raw["Peering"]; ok {
+		var peering config.Peering
+		if err := json.Unmarshal(data, &peering); err != nil {
+			log.Error("failed to parse peering config:", err)
+		} else if len(peering.Peers) != 0 {
+			peers = make([]peer.AddrInfo, len(peering.Peers))
+			for i, p := range peering.Peers {
+				peers[i] = peer.AddrInfo{
+					ID:    p.ID,
+					Addrs: p.Addrs,
+				}
+			}
+		}
+	}
+
+	return bootstrap, peers
+}
+
+// GetMigrationFetcher creates a fetcher, or set of fetchers, according to
+// the sources listed in cfg.DownloadSources. userAgent is sent as the
+// User-Agent header by any HTTP fetchers created. peers, typically the
+// repo's Peering.Peers, are passed to newIpfsFetcher for any "IPFS" source,
+// so that the temporary node it builds can pre-connect to them. newIpfsFetcher,
+// if non-nil, is used to construct the Fetcher for any "IPFS" source instead
+// of the package default, letting a caller supply its own bootstrap peers.
+//
+// Every other source is resolved through the scheme registry (see
+// RegisterFetcherScheme), so operators can plug in fetchers for schemes
+// Kubo doesn't know about without patching GetMigrationFetcher.
+func GetMigrationFetcher(cfg *config.Migration, userAgent string, peers []peer.AddrInfo, newIpfsFetcher func(peers []peer.AddrInfo) Fetcher) (Fetcher, error) {
+	if userAgent == "" {
+		userAgent = "go-ipfs"
+	}
+	if newIpfsFetcher == nil {
+		newIpfsFetcher = func(peers []peer.AddrInfo) Fetcher {
+			return ipfsfetcher.NewIpfsFetcher(DistPath, 0, nil, peers)
+		}
+	}
+
+	var fetchers []Fetcher
+
+	for _, src := range cfg.DownloadSources {
+		src = strings.TrimSpace(src)
+
+		switch strings.ToUpper(src) {
+		case "":
+			return nil, fmt.Errorf("empty string in Migration.DownloadSources")
+		case "IPFS":
+			fetchers = append(fetchers, newIpfsFetcher(peers))
+			continue
+		}
+
+		factory, resolvedSrc, err := resolveFetcherScheme(src)
+		if err != nil {
+			return nil, err
+		}
+		fetcher, err := factory(resolvedSrc, userAgent)
+		if err != nil {
+			return nil, err
+		}
+		fetchers = append(fetchers, fetcher)
+	}
+
+	if len(fetchers) == 0 {
+		return nil, fmt.Errorf("no sources specified in Migration.DownloadSources")
+	}
+	if len(fetchers) == 1 {
+		return fetchers[0], nil
+	}
+	return NewMultiFetcher(fetchers...), nil
+}
@@ -0,0 +1,345 @@
+package migrations
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	config "github.com/ipfs/go-ipfs-config"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/ipfs/go-ipfs/repo/fsrepo/migrations/ipfsfetcher"
+)
+
+var configData = `
+{
+	"Bootstrap": [
+		"/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt",
+		"/ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ"
+	],
+	"Migration": {
+		"DownloadSources": ["IPFS", "HTTP", "127.0.0.1"],
+		"Keep": "cache"
+	},
+	"Peering": {
+		"Peers": [
+			{
+				"ID": "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5",
+				"Addrs": ["/ip4/127.0.0.1/tcp/4001", "/ip4/127.0.0.1/udp/4001/quic"]
+			}
+		]
+	}
+}
+`
+
+var configDataBadPeers = `
+{
+	"Bootstrap": [
+		"/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt",
+		"/ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ"
+	],
+	"Migration": {
+		"DownloadSources": ["IPFS", "HTTP", "127.0.0.1"],
+		"Keep": "cache"
+	},
+	"Peering": "Unreadable-data"
+}
+`
+
+var configDataBadBootstrap = `
+{
+	"Bootstrap": "unreadable",
+	"Migration": {
+		"DownloadSources": ["IPFS", "HTTP", "127.0.0.1"],
+		"Keep": "cache"
+	},
+	"Peering": {
+		"Peers": [
+			{
+				"ID": "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5",
+				"Addrs": ["/ip4/127.0.0.1/tcp/4001", "/ip4/127.0.0.1/udp/4001/quic"]
+			}
+		]
+	}
+}
+`
+
+func makeConfig(configData string) string {
+	tmpDir, err := ioutil.TempDir("", "migrations_config_test")
+	if err != nil {
+		panic(err)
+	}
+
+	cfgFile, err := os.Create(filepath.Join(tmpDir, "config"))
+	if err != nil {
+		panic(err)
+	}
+	if _, err = cfgFile.Write([]byte(configData)); err != nil {
+		panic(err)
+	}
+	if err = cfgFile.Close(); err != nil {
+		panic(err)
+	}
+	return tmpDir
+}
+
+func TestReadMigrationConfig(t *testing.T) {
+	tmpDir := makeConfig(configData)
+	defer os.RemoveAll(tmpDir)
+
+	cfg, err := ReadMigrationConfig(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.DownloadSources) != 3 {
+		t.Fatal("wrong number of DownloadSources")
+	}
+	expect := []string{"IPFS", "HTTP", "127.0.0.1"}
+	for i := range expect {
+		if cfg.DownloadSources[i] != expect[i] {
+			t.Errorf("wrong DownloadSource at %d", i)
+		}
+	}
+
+	if cfg.Keep != "cache" {
+		t.Error("wrong value for Keep")
+	}
+}
+
+func TestReadMigrationConfigKeepPin(t *testing.T) {
+	tmpDir := makeConfig(strings.Replace(configData, `"Keep": "cache"`, `"Keep": "pin"`, 1))
+	defer os.RemoveAll(tmpDir)
+
+	cfg, err := ReadMigrationConfig(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Keep != "pin" {
+		t.Error("wrong value for Keep")
+	}
+}
+
+func TestReadMigrationConfigBadKeep(t *testing.T) {
+	tmpDir := makeConfig(strings.Replace(configData, `"Keep": "cache"`, `"Keep": "bogus"`, 1))
+	defer os.RemoveAll(tmpDir)
+
+	if _, err := ReadMigrationConfig(tmpDir); err == nil {
+		t.Fatal("expected error for unrecognized Keep value")
+	}
+}
+
+func TestReadIpfsConfig(t *testing.T) {
+	tmpDir := makeConfig(configData)
+	defer os.RemoveAll(tmpDir)
+
+	bootstrap, peers := ReadIpfsConfig(nil)
+	if bootstrap != nil || peers != nil {
+		t.Fatal("expected nil ipfs config items")
+	}
+
+	bootstrap, peers = ReadIpfsConfig(&tmpDir)
+	if len(bootstrap) != 2 {
+		t.Fatal("wrong number of bootstrap addresses")
+	}
+	if bootstrap[0] != "/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt" {
+		t.Fatal("wrong bootstrap address")
+	}
+
+	if len(peers) != 1 {
+		t.Fatal("wrong number of peers")
+	}
+
+	p := peers[0]
+	if p.ID.String() != "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5" {
+		t.Errorf("wrong ID for first peer")
+	}
+	if len(p.Addrs) != 2 {
+		t.Error("wrong number of addrs for first peer")
+	}
+}
+
+func TestReadPartialIpfsConfig(t *testing.T) {
+	tmpDir := makeConfig(configDataBadBootstrap)
+	defer os.RemoveAll(tmpDir)
+
+	bootstrap, peers := ReadIpfsConfig(&tmpDir)
+	if bootstrap != nil {
+		t.Fatal("expected nil bootstrap")
+	}
+	if len(peers) != 1 {
+		t.Fatal("wrong number of peers")
+	}
+	if len(peers[0].Addrs) != 2 {
+		t.Error("wrong number of addrs for first peer")
+	}
+	os.RemoveAll(tmpDir)
+
+	tmpDir = makeConfig(configDataBadPeers)
+	defer os.RemoveAll(tmpDir)
+
+	bootstrap, peers = ReadIpfsConfig(&tmpDir)
+	if peers != nil {
+		t.Fatal("expected nil peers")
+	}
+	if len(bootstrap) != 2 {
+		t.Fatal("wrong number of bootstrap addresses")
+	}
+	if bootstrap[0] != "/dnsaddr/bootstrap.libp2p.io/p2p/QmcZf59bWwK5XFi76CZX8cbJ4BhTzzA3gU1ZjYZcYW3dwt" {
+		t.Fatal("wrong bootstrap address")
+	}
+}
+
+func TestGetMigrationFetcher(t *testing.T) {
+	var f Fetcher
+	var err error
+
+	cfg := &config.Migration{}
+
+	cfg.DownloadSources = []string{"ftp://bad.gateway.io"}
+	_, err = GetMigrationFetcher(cfg, "", nil, nil)
+	if err == nil {
+		t.Fatal("Expected bad URL scheme error")
+	}
+
+	cfg.DownloadSources = []string{"ipfs"}
+	f, err = GetMigrationFetcher(cfg, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.(*ipfsfetcher.IpfsFetcher); !ok {
+		t.Fatal("expected IpfsFetcher")
+	}
+
+	cfg.DownloadSources = []string{"http"}
+	f, err = GetMigrationFetcher(cfg, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.(*HttpFetcher); !ok {
+		t.Fatal("expected HttpFetcher")
+	}
+
+	cfg.DownloadSources = []string{"IPFS", "HTTPS"}
+	f, err = GetMigrationFetcher(cfg, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf, ok := f.(*MultiFetcher)
+	if !ok {
+		t.Fatal("expected MultiFetcher")
+	}
+	if mf.Len() != 2 {
+		t.Fatal("expected 2 fetchers in MultiFetcher")
+	}
+
+	cfg.DownloadSources = []string{"ipfs", "https", "some.domain.io"}
+	f, err = GetMigrationFetcher(cfg, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf, ok = f.(*MultiFetcher)
+	if !ok {
+		t.Fatal("expected MultiFetcher")
+	}
+	if mf.Len() != 3 {
+		t.Fatal("expected 3 fetchers in MultiFetcher")
+	}
+
+	cfg.DownloadSources = nil
+	_, err = GetMigrationFetcher(cfg, "", nil, nil)
+	if err == nil {
+		t.Fatal("expected error when no sources specified")
+	}
+
+	cfg.DownloadSources = []string{"", ""}
+	_, err = GetMigrationFetcher(cfg, "", nil, nil)
+	if err == nil {
+		t.Fatal("expected error when empty string fetchers specified")
+	}
+
+	type fakeFetcher struct {
+		Fetcher
+		source string
+	}
+	RegisterFetcherScheme("s3", func(source, userAgent string) (Fetcher, error) {
+		return &fakeFetcher{source: source}, nil
+	})
+	t.Cleanup(func() {
+		schemeRegistryMu.Lock()
+		delete(schemeRegistry, "s3")
+		schemeRegistryMu.Unlock()
+	})
+
+	cfg.DownloadSources = []string{"ipfs", "s3://bucket/path", "https"}
+	f, err = GetMigrationFetcher(cfg, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf, ok = f.(*MultiFetcher)
+	if !ok {
+		t.Fatal("expected MultiFetcher")
+	}
+	if mf.Len() != 3 {
+		t.Fatal("expected 3 fetchers in MultiFetcher")
+	}
+	if _, ok := mf.Fetcher(0).(*ipfsfetcher.IpfsFetcher); !ok {
+		t.Fatal("expected IpfsFetcher first, to preserve DownloadSources order")
+	}
+	ff, ok := mf.Fetcher(1).(*fakeFetcher)
+	if !ok {
+		t.Fatal("expected custom s3 fetcher second, to preserve DownloadSources order")
+	}
+	if ff.source != "s3://bucket/path" {
+		t.Fatalf("expected custom fetcher to receive the untouched source, got %q", ff.source)
+	}
+	if _, ok := mf.Fetcher(2).(*HttpFetcher); !ok {
+		t.Fatal("expected HttpFetcher third, to preserve DownloadSources order")
+	}
+}
+
+func TestGetMigrationFetcherCustomIpfsFetcher(t *testing.T) {
+	called := false
+	newIpfsFetcher := func(peers []peer.AddrInfo) Fetcher {
+		called = true
+		return ipfsfetcher.NewIpfsFetcher(DistPath, 0, nil, peers)
+	}
+
+	cfg := &config.Migration{DownloadSources: []string{"ipfs"}}
+	if _, err := GetMigrationFetcher(cfg, "", nil, newIpfsFetcher); err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("expected custom newIpfsFetcher to be used")
+	}
+}
+
+func TestGetMigrationFetcherPassesPeers(t *testing.T) {
+	somePeer := peer.AddrInfo{ID: "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5"}
+
+	for _, tc := range []struct {
+		name  string
+		peers []peer.AddrInfo
+	}{
+		{"no peers", nil},
+		{"one peer", []peer.AddrInfo{somePeer}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotPeers []peer.AddrInfo
+			newIpfsFetcher := func(peers []peer.AddrInfo) Fetcher {
+				gotPeers = peers
+				return ipfsfetcher.NewIpfsFetcher(DistPath, 0, nil, peers)
+			}
+
+			cfg := &config.Migration{DownloadSources: []string{"ipfs"}}
+			if _, err := GetMigrationFetcher(cfg, "", tc.peers, newIpfsFetcher); err != nil {
+				t.Fatal(err)
+			}
+			if len(gotPeers) != len(tc.peers) {
+				t.Fatalf("expected %d peers to reach newIpfsFetcher, got %d", len(tc.peers), len(gotPeers))
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package migrations
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DownloadDirectory is where fetched migration archives and binaries are
+// written before they are run. It defaults to a subdirectory of the OS temp
+// directory, but may be overridden before migrations are fetched.
+var DownloadDirectory = filepath.Join(os.TempDir(), "ipfs-migrations")
@@ -0,0 +1,16 @@
+// Package migrations provides utilities for fetching and running the
+// repo migrations needed to move a repo from one version to the next.
+package migrations
+
+import "context"
+
+// Fetcher fetches a file, accessible at the given ipfsPath, and returns its
+// contents.
+type Fetcher interface {
+	// Fetch attempts to fetch the file at the given ipfsPath, and returns
+	// the contents of that file as a byte slice
+	Fetch(ctx context.Context, ipfsPath string) ([]byte, error)
+	// Close closes the fetcher, releasing any resources it may be holding
+	// open (network connections, temporary files, etc.)
+	Close() error
+}
@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// FetcherFactory constructs a Fetcher for a single DownloadSources entry.
+// source is the entry as configured (e.g. "https://example.com",
+// "s3://bucket/path", or a bare domain already rewritten to "https://...");
+// userAgent is whatever GetMigrationFetcher was called with.
+type FetcherFactory func(source, userAgent string) (Fetcher, error)
+
+var (
+	schemeRegistryMu sync.RWMutex
+	schemeRegistry   = map[string]FetcherFactory{}
+)
+
+func init() {
+	httpFactory := func(source, userAgent string) (Fetcher, error) {
+		return NewHttpFetcher(DistPath, source, userAgent, 0), nil
+	}
+	RegisterFetcherScheme("http", httpFactory)
+	RegisterFetcherScheme("https", httpFactory)
+}
+
+// RegisterFetcherScheme registers factory as the constructor used for any
+// Migration.DownloadSources entry whose URL scheme is name (matched
+// case-insensitively; see resolveFetcherScheme for the "HTTP"/"HTTPS" bare
+// keywords, which are a special case). This lets an operator plug in
+// fetchers - S3, IPFS Cluster, a local filesystem mirror, a different
+// trustless gateway - for a scheme Kubo doesn't know about, without
+// patching GetMigrationFetcher. Registering an existing name overrides the
+// built-in factory for it. RegisterFetcherScheme is safe to call
+// concurrently and is typically called from an init function before
+// GetMigrationFetcher runs.
+//
+// The "ipfs" keyword is not handled through this registry: it is always
+// resolved through GetMigrationFetcher's newIpfsFetcher parameter instead,
+// since constructing it requires the caller's bootstrap peers.
+func RegisterFetcherScheme(name string, factory FetcherFactory) {
+	schemeRegistryMu.Lock()
+	defer schemeRegistryMu.Unlock()
+	schemeRegistry[strings.ToLower(name)] = factory
+}
+
+// resolveFetcherScheme determines which registered factory should handle
+// src, and the source string to hand to it, in this order:
+//  1. src is the bare keyword "HTTP" or "HTTPS", in which case the factory
+//     receives defaultGatewayURL. This is the one bare-keyword form with an
+//     unambiguous meaning; a custom scheme registered for some other name
+//     has no such default, so it is only matched against an explicit URL
+//     scheme below.
+//  2. src has an explicit URL scheme matching a registered name - a
+//     "+trustless" suffix (e.g. "https+trustless") is stripped only for
+//     matching, so the factory still receives the untouched URL.
+//  3. src has no scheme at all, treated as a bare domain and resolved
+//     against the "https" factory.
+func resolveFetcherScheme(src string) (FetcherFactory, string, error) {
+	schemeRegistryMu.RLock()
+	defer schemeRegistryMu.RUnlock()
+
+	switch strings.ToUpper(src) {
+	case "HTTP", "HTTPS":
+		factory, ok := schemeRegistry[strings.ToLower(src)]
+		if !ok {
+			return nil, "", fmt.Errorf("no fetcher registered for scheme %q", strings.ToLower(src))
+		}
+		return factory, defaultGatewayURL, nil
+	}
+
+	u, err := url.Parse(src)
+	if err != nil {
+		return nil, "", fmt.Errorf("bad URL %q in Migration.DownloadSources: %w", src, err)
+	}
+
+	if u.Scheme == "" {
+		factory, ok := schemeRegistry["https"]
+		if !ok {
+			return nil, "", fmt.Errorf("no fetcher registered for scheme %q", "https")
+		}
+		return factory, "https://" + src, nil
+	}
+
+	lookupKey := strings.TrimSuffix(strings.ToLower(u.Scheme), "+trustless")
+	factory, ok := schemeRegistry[lookupKey]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported URL scheme %q in Migration.DownloadSources", u.Scheme)
+	}
+	return factory, src, nil
+}
@@ -0,0 +1,230 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// trustlessHTTPScheme and its https counterpart mark a DownloadSources entry as
+// a trustless HTTP gateway: one that must not be trusted to serve correct
+// bytes, and whose response is instead verified locally, block by block.
+const (
+	trustlessHTTPScheme  = "http+trustless"
+	trustlessHTTPSScheme = "https+trustless"
+
+	carAcceptHeader = "application/vnd.ipld.car"
+)
+
+// defaultFetchLimit caps the total bytes read for a single Fetch call -
+// either a migration binary or a trustless CAR response - when the caller
+// does not request a specific limit. Without some cap, a malicious or
+// misbehaving server can exhaust memory or disk by streaming an unbounded
+// response, especially over chunked encoding where Content-Length never
+// gives an up-front warning.
+const defaultFetchLimit = 1 << 30 // 1GiB
+
+// HttpFetcher fetches files over HTTP, either directly or, when the
+// configured URL uses the http+trustless or https+trustless scheme, as a
+// verified CAR stream.
+type HttpFetcher struct {
+	distPath  string
+	baseURL   string
+	userAgent string
+	limit     int64
+
+	trustless bool
+}
+
+// NewHttpFetcher creates a new HttpFetcher that fetches files under
+// distPath from fetchURL. limit caps the number of bytes read for any
+// single file; if limit is non-positive, defaultFetchLimit is used instead,
+// so callers cannot accidentally get an unbounded fetch by passing 0. If
+// fetchURL uses the http+trustless:// or https+trustless:// scheme, the
+// fetcher requests a verified CAR stream instead of trusting the gateway's
+// response bytes directly.
+func NewHttpFetcher(distPath, fetchURL, userAgent string, limit int64) *HttpFetcher {
+	if limit <= 0 {
+		limit = defaultFetchLimit
+	}
+	base, trustless := stripTrustlessScheme(fetchURL)
+	return &HttpFetcher{
+		distPath:  distPath,
+		baseURL:   strings.TrimRight(base, "/"),
+		userAgent: userAgent,
+		limit:     limit,
+		trustless: trustless,
+	}
+}
+
+// stripTrustlessScheme reports whether fetchURL opts into trustless
+// verification, returning the URL rewritten to a plain http(s) scheme that
+// net/http understands.
+func stripTrustlessScheme(fetchURL string) (string, bool) {
+	u, err := url.Parse(fetchURL)
+	if err != nil {
+		return fetchURL, false
+	}
+	switch u.Scheme {
+	case trustlessHTTPScheme:
+		u.Scheme = "http"
+		return u.String(), true
+	case trustlessHTTPSScheme:
+		u.Scheme = "https"
+		return u.String(), true
+	default:
+		return fetchURL, false
+	}
+}
+
+// Fetch fetches the file at ipfsPath, which must be a path rooted at a CID
+// (e.g. "/QmFoo/versions"). When the fetcher is configured for trustless
+// mode, it requests the path as a CAR and verifies every returned block
+// before returning its reassembled bytes; otherwise it fetches the path
+// directly and returns the response body as-is.
+func (f *HttpFetcher) Fetch(ctx context.Context, ipfsPath string) ([]byte, error) {
+	if f.trustless {
+		return f.fetchTrustless(ctx, ipfsPath)
+	}
+	return f.fetchDirect(ctx, ipfsPath)
+}
+
+func (f *HttpFetcher) fetchDirect(ctx context.Context, ipfsPath string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.baseURL+ipfsPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", req.URL, resp.Status)
+	}
+
+	body := bodyReader(resp, f.limit)
+	return io.ReadAll(body)
+}
+
+// fetchTrustless requests ipfsPath as a CAR with a selector scoped to the
+// path's target, then verifies and extracts the UnixFS bytes it describes:
+// car frames are verified and walked as they stream in, and the walk
+// appends the file's bytes to an in-memory buffer, so the whole
+// reassembled file is held in memory before it is returned.
+func (f *HttpFetcher) fetchTrustless(ctx context.Context, ipfsPath string) ([]byte, error) {
+	root, subPath, err := splitIpfsPath(ipfsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	reqURL := f.baseURL + "/ipfs/" + root.String() + subPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", carAcceptHeader+"; dups=n; order=dfs")
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", req.URL, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, carAcceptHeader) {
+		return nil, fmt.Errorf("gateway returned unexpected content-type %q for trustless request", ct)
+	}
+
+	if err := checkContentLength(resp, f.limit); err != nil {
+		return nil, err
+	}
+
+	body := bodyReader(resp, f.limit)
+
+	var out strings.Builder
+	extractor := newVerifyingCarExtractor(0)
+	if err := extractor.extract(ctx, body, root, &out); err != nil {
+		return nil, fmt.Errorf("verifying CAR response from %s: %w", f.baseURL, err)
+	}
+
+	return []byte(out.String()), nil
+}
+
+// splitIpfsPath splits an "/<cid>/sub/path" style path into its root CID
+// and the remaining sub-path.
+func splitIpfsPath(ipfsPath string) (cid.Cid, string, error) {
+	trimmed := strings.TrimPrefix(ipfsPath, "/")
+	first, rest, _ := strings.Cut(trimmed, "/")
+
+	root, err := cid.Decode(first)
+	if err != nil {
+		return cid.Undef, "", fmt.Errorf("invalid root in path %q: %w", ipfsPath, err)
+	}
+	if rest == "" {
+		return root, "", nil
+	}
+	return root, "/" + rest, nil
+}
+
+// checkContentLength rejects a response up front when the server has told
+// us, via Content-Length, that the body is larger than our configured
+// limit. This stops an oversized response from ever being read when the
+// server is well-behaved enough to report its size; readCarFrame still
+// guards per-frame size for servers that are not.
+func checkContentLength(resp *http.Response, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	if resp.ContentLength > limit {
+		return fmt.Errorf("response size %d exceeds %d byte limit", resp.ContentLength, limit)
+	}
+	return nil
+}
+
+func bodyReader(resp *http.Response, limit int64) io.Reader {
+	if limit <= 0 {
+		return resp.Body
+	}
+	return io.LimitReader(resp.Body, limit)
+}
+
+// FetchBinary downloads the distribution archive named by dist/version/name
+// under f.distPath, writing it into outDir and returning the path to the
+// file it wrote. It is used for migration binaries, which are not part of a
+// UnixFS DAG, so it always uses the direct (non-CAR) path even when the
+// fetcher is otherwise configured for trustless mode.
+func (f *HttpFetcher) FetchBinary(ctx context.Context, dist, version, name, outDir string) (string, error) {
+	data, err := f.fetchDirect(ctx, path.Join("/", f.distPath, dist, version, name))
+	if err != nil {
+		return "", err
+	}
+
+	outPath := path.Join(outDir, name)
+	if err := os.WriteFile(outPath, data, 0755); err != nil {
+		return "", err
+	}
+	return outPath, nil
+}
+
+// Close implements Fetcher. HttpFetcher holds no long-lived resources.
+func (f *HttpFetcher) Close() error {
+	return nil
+}
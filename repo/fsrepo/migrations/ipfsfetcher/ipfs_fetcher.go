@@ -0,0 +1,297 @@
+// Package ipfsfetcher implements a migrations.Fetcher that retrieves
+// migration files from the IPFS network, using a temporary, in-process
+// IPFS node.
+package ipfsfetcher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	config "github.com/ipfs/go-ipfs-config"
+	files "github.com/ipfs/go-ipfs-files"
+	logging "github.com/ipfs/go-log"
+	iface "github.com/ipfs/interface-go-ipfs-core"
+	icorepath "github.com/ipfs/interface-go-ipfs-core/path"
+	host "github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+var log = logging.Logger("ipfsfetcher")
+
+// peeringTag is the connection manager tag used to protect connections to
+// configured Peering.Peers from being trimmed while a migration fetch is in
+// progress.
+const peeringTag = "migrations-peering"
+
+// defaultFetchLimit caps the bytes read for a single Fetch call when the
+// caller does not request a specific limit, mirroring HttpFetcher's own
+// default: without some cap, a file served by a misbehaving or malicious
+// peer could otherwise be read into memory without bound.
+const defaultFetchLimit = 1 << 30 // 1GiB
+
+// IpfsFetcher fetches files from the IPFS network using a temporary,
+// unpersisted IPFS node. The node is started lazily, the first time Fetch is
+// called, and is shut down when Close is called.
+type IpfsFetcher struct {
+	// distPath is carried for parity with HttpFetcher's constructor, which
+	// takes the same argument; unlike HttpFetcher, nothing here joins it
+	// onto fetched paths yet; Fetch expects ipfsPath to already be a
+	// CID-rooted path, the same as HttpFetcher.Fetch does.
+	distPath  string
+	limit     int64
+	bootstrap []string
+	peers     []peer.AddrInfo
+
+	// startMu serializes attempts to start the temporary node; unlike a
+	// sync.Once, a failed attempt (e.g. its ctx was canceled mid-startup)
+	// is not cached permanently, so a later Fetch call gets to retry.
+	startMu sync.Mutex
+
+	mu       sync.Mutex
+	repoRoot string
+	node     *core.IpfsNode
+	ipfs     iface.CoreAPI
+	host     host.Host
+	self     *peer.AddrInfo
+	fetched  []cid.Cid
+}
+
+// NewIpfsFetcher creates a new IpfsFetcher. distPath is stored on the
+// fetcher but is not joined onto the paths passed to Fetch, which must
+// already be CID-rooted. limit restricts the maximum number
+// of bytes that will be fetched for any single file; if limit is
+// non-positive, defaultFetchLimit is used instead, so callers cannot
+// accidentally get an unbounded fetch by passing 0. bootstrap seeds the
+// temporary node's routing table; peers are additionally dialed directly
+// and protected in the connection manager, so that operators who already
+// peer with dedicated infrastructure get fast, reliable migration downloads
+// instead of depending on discovery.
+func NewIpfsFetcher(distPath string, limit int64, bootstrap []string, peers []peer.AddrInfo) *IpfsFetcher {
+	if limit <= 0 {
+		limit = defaultFetchLimit
+	}
+	return &IpfsFetcher{
+		distPath:  distPath,
+		limit:     limit,
+		bootstrap: bootstrap,
+		peers:     peers,
+	}
+}
+
+// Fetch attempts to fetch the file at ipfsPath from the IPFS network,
+// starting the temporary node if it is not already running and connecting
+// to any configured peering peers before resolving ipfsPath.
+func (f *IpfsFetcher) Fetch(ctx context.Context, ipfsPath string) ([]byte, error) {
+	if err := f.startNode(ctx); err != nil {
+		return nil, err
+	}
+
+	p := toIpfsPath(ipfsPath)
+	resolved, err := f.ipfs.ResolvePath(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", ipfsPath, err)
+	}
+
+	node, err := f.ipfs.Unixfs().Get(ctx, resolved)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", ipfsPath, err)
+	}
+	defer node.Close()
+
+	file, ok := node.(files.File)
+	if !ok {
+		return nil, fmt.Errorf("%s is a directory, not a file", ipfsPath)
+	}
+
+	var r io.Reader = file
+	if f.limit > 0 {
+		r = io.LimitReader(file, f.limit)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", ipfsPath, err)
+	}
+
+	f.mu.Lock()
+	f.fetched = append(f.fetched, resolved.Cid())
+	f.mu.Unlock()
+
+	return data, nil
+}
+
+// toIpfsPath turns ipfsPath, a CID-rooted path such as "/QmFoo/versions" or
+// one already namespaced as "/ipfs/QmFoo/versions", into an icorepath.Path
+// that the core API can resolve.
+func toIpfsPath(ipfsPath string) icorepath.Path {
+	if !strings.HasPrefix(ipfsPath, "/") {
+		ipfsPath = "/" + ipfsPath
+	}
+	switch {
+	case strings.HasPrefix(ipfsPath, "/ipfs/"),
+		strings.HasPrefix(ipfsPath, "/ipld/"),
+		strings.HasPrefix(ipfsPath, "/ipns/"):
+		return icorepath.New(ipfsPath)
+	default:
+		return icorepath.New("/ipfs" + ipfsPath)
+	}
+}
+
+// startNode starts the temporary IPFS node used for fetching, unless a
+// previous call already started it successfully. Unlike a sync.Once, a
+// failed attempt is not cached: if ctx was canceled (or the node otherwise
+// failed to start) on one call, a later call retries doStartNode with its
+// own ctx, rather than every future Fetch failing forever because of one
+// caller's canceled context.
+func (f *IpfsFetcher) startNode(ctx context.Context) error {
+	f.startMu.Lock()
+	defer f.startMu.Unlock()
+
+	f.mu.Lock()
+	started := f.node != nil
+	f.mu.Unlock()
+	if started {
+		return nil
+	}
+
+	return f.doStartNode(ctx)
+}
+
+// doStartNode builds a throwaway repo in a temp directory, starts an
+// online IPFS node against it, and pre-connects it to f.peers. The node's
+// identity and storage are never persisted beyond Close.
+func (f *IpfsFetcher) doStartNode(ctx context.Context) error {
+	repoRoot, err := os.MkdirTemp("", "ipfs-migration-fetch")
+	if err != nil {
+		return fmt.Errorf("creating temp repo for migration fetch node: %w", err)
+	}
+
+	cfg, err := config.Init(io.Discard, 2048)
+	if err != nil {
+		os.RemoveAll(repoRoot)
+		return fmt.Errorf("initializing temp node config: %w", err)
+	}
+	if len(f.bootstrap) > 0 {
+		cfg.Bootstrap = f.bootstrap
+	}
+
+	if err := fsrepo.Init(repoRoot, cfg); err != nil {
+		os.RemoveAll(repoRoot)
+		return fmt.Errorf("initializing temp node repo: %w", err)
+	}
+
+	r, err := fsrepo.Open(repoRoot)
+	if err != nil {
+		os.RemoveAll(repoRoot)
+		return fmt.Errorf("opening temp node repo: %w", err)
+	}
+
+	node, err := core.NewNode(ctx, &core.BuildCfg{
+		Online:  true,
+		Routing: libp2p.DHTClientOption,
+		Repo:    r,
+	})
+	if err != nil {
+		os.RemoveAll(repoRoot)
+		return fmt.Errorf("starting temp migration fetch node: %w", err)
+	}
+
+	api, err := coreapi.NewCoreAPI(node)
+	if err != nil {
+		node.Close()
+		os.RemoveAll(repoRoot)
+		return fmt.Errorf("getting core API for temp migration fetch node: %w", err)
+	}
+
+	f.mu.Lock()
+	f.repoRoot = repoRoot
+	f.node = node
+	f.ipfs = api
+	f.host = node.PeerHost
+	f.self = &peer.AddrInfo{ID: node.PeerHost.ID(), Addrs: node.PeerHost.Addrs()}
+	f.mu.Unlock()
+
+	return f.connectPeers(ctx)
+}
+
+// connectPeers dials and protects every configured peering peer on the
+// temporary node's host, so they cannot be trimmed by the connection
+// manager while the fetch is in progress. It is a no-op until the
+// temporary node's host has actually been started.
+func (f *IpfsFetcher) connectPeers(ctx context.Context) error {
+	f.mu.Lock()
+	h := f.host
+	peers := f.peers
+	f.mu.Unlock()
+
+	if h == nil || len(peers) == 0 {
+		return nil
+	}
+
+	cm := h.ConnManager()
+	for _, p := range peers {
+		if err := h.Connect(ctx, p); err != nil {
+			log.Errorf("failed to connect to peering peer %s: %s", p.ID, err)
+			continue
+		}
+		cm.Protect(p.ID, peeringTag)
+	}
+	return nil
+}
+
+// Close shuts down the temporary IPFS node, if it was started, and removes
+// its throwaway repo.
+func (f *IpfsFetcher) Close() error {
+	f.mu.Lock()
+	node := f.node
+	repoRoot := f.repoRoot
+	f.mu.Unlock()
+
+	if node == nil {
+		return nil
+	}
+
+	err := node.Close()
+	if rmErr := os.RemoveAll(repoRoot); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// AddrInfos returns the list of peering peers configured for this
+// fetcher's temporary node to dial and protect; the bootstrap addresses
+// are not included.
+func (f *IpfsFetcher) AddrInfos() []peer.AddrInfo {
+	return f.peers
+}
+
+// NodeAddr returns the temporary node's own listening address, so that
+// another node can dial directly into it, along with whether the temporary
+// node has been started yet.
+func (f *IpfsFetcher) NodeAddr() (peer.AddrInfo, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.self == nil {
+		return peer.AddrInfo{}, false
+	}
+	return *f.self, true
+}
+
+// FetchedCids returns the CIDs of the root blocks this fetcher has
+// retrieved so far, in the order they were fetched.
+func (f *IpfsFetcher) FetchedCids() []cid.Cid {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]cid.Cid, len(f.fetched))
+	copy(out, f.fetched)
+	return out
+}
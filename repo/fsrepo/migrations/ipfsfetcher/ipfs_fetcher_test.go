@@ -0,0 +1,54 @@
+package ipfsfetcher
+
+import (
+	"context"
+	"testing"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	network "github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// TestConnectPeersProtectsConnection spins up two in-process libp2p hosts
+// and confirms that connectPeers dials the configured peer and protects
+// the resulting connection in the connection manager, before any bitswap
+// request would be issued against it.
+func TestConnectPeersProtectsConnection(t *testing.T) {
+	ctx := context.Background()
+
+	pinnedHost, err := libp2p.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pinnedHost.Close()
+
+	migrationHost, err := libp2p.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer migrationHost.Close()
+
+	pinnedInfo := peer.AddrInfo{ID: pinnedHost.ID(), Addrs: pinnedHost.Addrs()}
+
+	f := NewIpfsFetcher("", 0, nil, []peer.AddrInfo{pinnedInfo})
+	f.host = migrationHost
+
+	if err := f.connectPeers(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if migrationHost.Network().Connectedness(pinnedHost.ID()) != network.Connected {
+		t.Fatal("expected migration host to be connected to the pinned peer")
+	}
+
+	if !migrationHost.ConnManager().IsProtected(pinnedHost.ID(), peeringTag) {
+		t.Fatal("expected connection to the pinned peer to be protected")
+	}
+}
+
+func TestConnectPeersNoopWithoutHost(t *testing.T) {
+	f := NewIpfsFetcher("", 0, nil, []peer.AddrInfo{{ID: "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5"}})
+	if err := f.connectPeers(context.Background()); err != nil {
+		t.Fatalf("expected no-op when host is not yet started, got: %v", err)
+	}
+}
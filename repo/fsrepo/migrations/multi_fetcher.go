@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+)
+
+// MultiFetcher wraps a series of fetchers, trying each in order until one
+// succeeds. It is used to allow multiple download sources for a migration,
+// falling back to the next source if an earlier one fails.
+type MultiFetcher struct {
+	fetchers []Fetcher
+}
+
+// NewMultiFetcher creates a MultiFetcher from one or more Fetchers. The
+// fetchers are tried in the order given.
+func NewMultiFetcher(fetchers ...Fetcher) *MultiFetcher {
+	return &MultiFetcher{fetchers: fetchers}
+}
+
+// Len returns the number of fetchers in the MultiFetcher.
+func (f *MultiFetcher) Len() int {
+	return len(f.fetchers)
+}
+
+// Fetcher returns the fetcher at index i, in the order given to
+// NewMultiFetcher.
+func (f *MultiFetcher) Fetcher(i int) Fetcher {
+	return f.fetchers[i]
+}
+
+// Fetch attempts to fetch ipfsPath using each of the fetchers in order,
+// returning the result of the first one that succeeds. If all fetchers
+// fail, the error from the last fetcher is returned.
+func (f *MultiFetcher) Fetch(ctx context.Context, ipfsPath string) ([]byte, error) {
+	if len(f.fetchers) == 0 {
+		return nil, fmt.Errorf("no fetchers configured")
+	}
+
+	var err error
+	for _, fetcher := range f.fetchers {
+		var out []byte
+		out, err = fetcher.Fetch(ctx, ipfsPath)
+		if err == nil {
+			return out, nil
+		}
+	}
+	return nil, err
+}
+
+// Close closes all the fetchers in the MultiFetcher, returning the first
+// error encountered, if any.
+func (f *MultiFetcher) Close() error {
+	var err error
+	for _, fetcher := range f.fetchers {
+		if cerr := fetcher.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}